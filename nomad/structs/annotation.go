@@ -0,0 +1,21 @@
+package structs
+
+// The AnnotationSeverity* values classify how urgently an operator should look at a
+// structs.Annotation before applying the plan.
+const (
+	AnnotationSeverityInfo     = "info"
+	AnnotationSeverityWarn     = "warn"
+	AnnotationSeverityCritical = "critical"
+)
+
+// Annotation is the structured, machine-readable counterpart to the
+// free-form Annotations []string carried by FieldDiff, TaskDiff and
+// TaskGroupDiff. It has no marshaling logic of its own: it is a plain
+// exported struct on JobDiff's tree, so it serializes for free wherever a
+// JobDiff does, including the /v1/job/:id/plan HTTP response.
+type Annotation struct {
+	Code      string
+	Severity  string
+	FieldPath string
+	Detail    map[string]string
+}
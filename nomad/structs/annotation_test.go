@@ -0,0 +1,42 @@
+package structs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnnotationJSONRoundTrip confirms that StructuredAnnotations survives
+// the same JSON encode/decode cycle the job HTTP endpoint applies to a
+// JobDiff when serving /v1/job/:id/plan, so exposing it there needs no
+// handler change beyond returning the annotated JobDiff it already returns.
+func TestAnnotationJSONRoundTrip(t *testing.T) {
+	diff := &JobDiff{
+		Type: DiffTypeEdited,
+		ID:   "example",
+		TaskGroups: []*TaskGroupDiff{
+			{
+				Type: DiffTypeEdited,
+				Name: "cache",
+				StructuredAnnotations: []Annotation{
+					{
+						Code:      "COUNT_INCREASE",
+						Severity:  AnnotationSeverityInfo,
+						FieldPath: "Count",
+						Detail:    map[string]string{"old": "1", "new": "2"},
+					},
+				},
+			},
+		},
+	}
+
+	encoded, err := json.Marshal(diff)
+	require.NoError(t, err)
+
+	var decoded JobDiff
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+
+	require.Len(t, decoded.TaskGroups, 1)
+	require.Equal(t, diff.TaskGroups[0].StructuredAnnotations, decoded.TaskGroups[0].StructuredAnnotations)
+}
@@ -0,0 +1,138 @@
+package structs
+
+// The DiffType* values denote the type of change a diff entry represents.
+const (
+	DiffTypeNone    = "None"
+	DiffTypeAdded   = "Added"
+	DiffTypeDeleted = "Deleted"
+	DiffTypeEdited  = "Edited"
+)
+
+// AllocDesiredStatus values are set by the reconciler on an Allocation to
+// tell the client what should happen to it next.
+const (
+	AllocDesiredStatusRun  = "run"
+	AllocDesiredStatusStop = "stop"
+
+	// AllocDesiredStatusRemove marks an allocation that belongs to a
+	// superseded batch/periodic/dispatch iteration rather than a normal
+	// scale-down; it is GC'd once the client reports it rather than being
+	// drained like a AllocDesiredStatusStop allocation.
+	AllocDesiredStatusRemove = "remove"
+)
+
+// Allocation is the minimal view of a scheduled allocation the reconciler
+// needs in order to decide whether it belongs to a stale job iteration.
+type Allocation struct {
+	ID            string
+	TaskGroup     string
+	Iteration     uint64
+	DesiredStatus string
+}
+
+// AllocMetrics groups a count of allocations by the task group they belong
+// to, e.g. how many stale-iteration allocations were marked for removal in
+// each task group.
+type AllocMetrics struct {
+	TaskGroups map[string]uint64
+}
+
+// FieldDiff contains information about a diff on a primitive field.
+type FieldDiff struct {
+	Type                  string
+	Name                  string
+	Old, New              string
+	Annotations           []string
+	StructuredAnnotations []Annotation
+}
+
+// ObjectDiff contains the diff between a set of sub-objects, e.g. a Task's
+// LogConfig or Template blocks.
+type ObjectDiff struct {
+	Type    string
+	Name    string
+	Fields  []*FieldDiff
+	Objects []*ObjectDiff
+}
+
+// TaskDiff contains the diff of a single task within a task group.
+type TaskDiff struct {
+	Type                  string
+	Name                  string
+	Fields                []*FieldDiff
+	Objects               []*ObjectDiff
+	Annotations           []string
+	StructuredAnnotations []Annotation
+}
+
+// TaskGroupDiff contains the diff of a single task group within a job.
+type TaskGroupDiff struct {
+	Type                  string
+	Name                  string
+	Fields                []*FieldDiff
+	Objects               []*ObjectDiff
+	Tasks                 []*TaskDiff
+	Updates               map[string]uint64
+	Annotations           []string
+	StructuredAnnotations []Annotation
+}
+
+// JobDiff contains the diff of a Job.
+type JobDiff struct {
+	Type       string
+	ID         string
+	Fields     []*FieldDiff
+	Objects    []*ObjectDiff
+	TaskGroups []*TaskGroupDiff
+
+	// Iteration and LastExecution identify which batch/periodic/dispatch
+	// run of the job this diff belongs to. They are copied from the
+	// PlanAnnotations of the same name and are zero/unset for jobs that
+	// don't carry an iteration counter.
+	Iteration     uint64
+	LastExecution int64
+}
+
+// PlanAnnotations holds the scheduler's additional information about a plan
+// that the diff annotator folds onto the JobDiff it produces.
+type PlanAnnotations struct {
+	DesiredTGUpdates map[string]*DesiredUpdates
+
+	// Iteration and LastExecution are the job's current run counter and the
+	// unix time it was last executed, set by the reconciler for batch,
+	// periodic and dispatch jobs.
+	Iteration     uint64
+	LastExecution int64
+}
+
+// DesiredUpdates counts, for a single task group, how many of its
+// allocations the scheduler intends to handle each way.
+type DesiredUpdates struct {
+	Ignore            uint64
+	Place             uint64
+	Migrate           uint64
+	Stop              uint64
+	InPlaceUpdate     uint64
+	DestructiveUpdate uint64
+
+	// StaleIteration counts allocations left over from a JobDiff.Iteration
+	// older than the job's current one. The reconciler marks these
+	// DesiredStatus=AllocDesiredStatusRemove once a late-joining node reports them, rather
+	// than folding them into Stop, so operators can see they're being
+	// cleaned up as GC rather than as a normal scale-down.
+	StaleIteration uint64
+
+	// Canary and MaxParallel are copied from the task group's UpdateStrategy
+	// by the reconciler (see ApplyRolloutPlan) so that the destructive
+	// update count above can be split into its phased-rollout components
+	// instead of applied all at once.
+	Canary      uint64
+	MaxParallel int
+}
+
+// UpdateStrategy is the subset of a task group's Update stanza the
+// reconciler needs in order to plan a phased rollout.
+type UpdateStrategy struct {
+	Canary      uint64
+	MaxParallel int
+}
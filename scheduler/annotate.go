@@ -1,7 +1,9 @@
 package scheduler
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/nomad/nomad/structs"
 )
@@ -13,6 +15,32 @@ const (
 	AnnotationForcesDestructiveUpdate = "forces create/destroy update"
 )
 
+// inplaceTaskFields is the whitelist of primitive field names on a Task
+// diff that can be applied without destroying and recreating the task's
+// allocation. Both annotateTask (via allowsInplaceTaskUpdate, see
+// reconcile_inplace.go) and the reconciler's in-place-update decision
+// consult this same table, so the plan output here and the scheduler's
+// actual update never diverge.
+var inplaceTaskFields = map[string]struct{}{
+	"Env":           {},
+	"Meta":          {},
+	"KillTimeout":   {},
+	"ShutdownDelay": {},
+}
+
+// inplaceTaskObjects is the whitelist of nested object diffs on a Task
+// that can be applied without destroying and recreating the task's
+// allocation. Some entries (see isInplaceObject) additionally depend on
+// the contents of the diff, not just its name.
+var inplaceTaskObjects = map[string]struct{}{
+	"LogConfig":  {},
+	"Service":    {},
+	"Constraint": {},
+	"Vault":      {},
+	"Artifact":   {},
+	"Template":   {},
+}
+
 // UpdateTypes denote the type of update to occur against the task group.
 const (
 	UpdateTypeIgnore            = "ignore"
@@ -21,25 +49,106 @@ const (
 	UpdateTypeMigrate           = "migrate"
 	UpdateTypeInplaceUpdate     = "in-place update"
 	UpdateTypeDestructiveUpdate = "create/destroy update"
+
+	// UpdateTypeReplaceStaleIteration marks allocations left over from a
+	// prior batch/periodic/dispatch iteration of the job. They belong to a
+	// JobDiff.Iteration that is no longer the job's most recent, so the
+	// reconciler is free to garbage collect them once a late-joining node
+	// reports them.
+	UpdateTypeReplaceStaleIteration = "stale iteration replace"
+
+	// UpdateTypeCanary, UpdateTypeRollingBatch and UpdateTypePromote split
+	// a destructive update count that is governed by the task group's
+	// Update stanza into its phased-rollout components, instead of folding
+	// everything into one opaque UpdateTypeDestructiveUpdate count.
+	UpdateTypeCanary       = "canary"
+	UpdateTypeRollingBatch = "rolling batch"
+	UpdateTypePromote      = "requires manual promote"
+)
+
+// AnnotationStaleIteration marks a task group update count that comes from
+// allocations of a previous JobDiff.Iteration rather than the job's most
+// recent submission.
+const AnnotationStaleIteration = "superseded by a more recent iteration"
+
+// Annotation codes are stable, machine-readable identifiers emitted
+// alongside the free-form strings above. Every diff type that carries
+// Annotations []string also carries a parallel StructuredAnnotations
+// []structs.Annotation; policy engines (Sentinel, OPA) and CI gates should
+// match on these codes instead of substring-matching the English text.
+const (
+	AnnotationCodeCountIncrease         = "COUNT_INCREASE"
+	AnnotationCodeCountDecrease         = "COUNT_DECREASE"
+	AnnotationCodeTaskFieldInplace      = "TASK_FIELD_INPLACE"
+	AnnotationCodeTaskFieldDestructive  = "TASK_FIELD_DESTRUCTIVE"
+	AnnotationCodeTaskObjectInplace     = "TASK_OBJECT_INPLACE"
+	AnnotationCodeTaskObjectDestructive = "TASK_OBJECT_DESTRUCTIVE"
+	AnnotationCodeStaleIteration        = "STALE_ITERATION"
+	AnnotationCodeCanary                = "ROLLOUT_CANARY"
+	AnnotationCodeRollingBatch          = "ROLLOUT_ROLLING_BATCH"
+	AnnotationCodePromoteRequired       = "ROLLOUT_PROMOTE_REQUIRED"
 )
 
+// structuredAnnotation builds a structs.Annotation with the given code,
+// severity and field path, stashing old/new values in Detail when both are
+// non-empty.
+func structuredAnnotation(code, severity, fieldPath, old, newVal string) structs.Annotation {
+	a := structs.Annotation{
+		Code:      code,
+		Severity:  severity,
+		FieldPath: fieldPath,
+	}
+	if old != "" || newVal != "" {
+		a.Detail = map[string]string{"old": old, "new": newVal}
+	}
+	return a
+}
+
 // Annotate takes the diff between the old and new version of a Job, the
 // scheduler's plan annotations and will add annotations to the diff to aide
 // human understanding of the plan.
 //
 // Currently the things that are annotated are:
 // * Task group changes will be annotated with:
-//    * Count up and count down changes
-//    * Update counts (creates, destroys, migrates, etc)
+//   - Count up and count down changes
+//   - Update counts (creates, destroys, migrates, etc)
+//
 // * Task changes will be annotated with:
-//    * forces create/destroy update
-//    * forces in-place update
+//   - forces create/destroy update
+//   - forces in-place update
+//
+// Batch/periodic/dispatch jobs additionally get their current
+// Iteration/LastExecution copied onto the diff, and task groups get an
+// update count for allocations left over from a stale iteration. The
+// per-allocation DesiredStatus=Remove marking and its AllocMetrics grouping
+// happen in markStaleIterationAllocs (see reconcile_stale_iteration.go);
+// Annotate only renders the resulting count that lands in
+// PlanAnnotations.DesiredTGUpdates[name].StaleIteration.
+//
+// Every Annotations []string entry produced above has a matching
+// structs.Annotation appended to the diff's StructuredAnnotations, with a
+// stable Code, Severity and FieldPath so policy engines can gate on it
+// without parsing English text. StructuredAnnotations is an exported field
+// on the same JobDiff the job HTTP endpoint already serializes for
+// /v1/job/:id/plan, so it round-trips to API consumers with no separate
+// endpoint change; see structs.TestAnnotationJSONRoundTrip.
+//
+// Task groups whose Update stanza requests a canary and/or rolling
+// (MaxParallel) deployment get their destructive-update count split into
+// per-batch canary/rolling-batch/promote annotations rather than one
+// opaque count; see annotateRollout.
 func Annotate(diff *structs.JobDiff, annotations *structs.PlanAnnotations) error {
 	// No annotation needed as the job was either just submitted or deleted.
 	if diff.Type != structs.DiffTypeEdited {
 		return nil
 	}
 
+	// Batch, periodic and dispatch jobs carry an iteration counter so
+	// operators (and the reconciler) can tell which run a given allocation
+	// belongs to. Non-iterated jobs leave annotations.Iteration at zero and
+	// this is a no-op.
+	annotateJobIteration(diff, annotations)
+
 	tgDiffs := diff.TaskGroups
 	if len(tgDiffs) == 0 {
 		return nil
@@ -54,6 +163,19 @@ func Annotate(diff *structs.JobDiff, annotations *structs.PlanAnnotations) error
 	return nil
 }
 
+// annotateJobIteration copies the job's iteration counter and the
+// timestamp of its last execution from the plan annotations onto the job
+// diff, so API consumers of the plan response can tell which dispatch a
+// plan is for without re-deriving it from the allocation set.
+func annotateJobIteration(diff *structs.JobDiff, annotations *structs.PlanAnnotations) {
+	if annotations == nil || annotations.Iteration == 0 {
+		return
+	}
+
+	diff.Iteration = annotations.Iteration
+	diff.LastExecution = annotations.LastExecution
+}
+
 // annotateTaskGroup takes a task group diff and annotates it.
 func annotateTaskGroup(diff *structs.TaskGroupDiff, annotations *structs.PlanAnnotations) error {
 	// Don't annotate unless the task group was edited. If it was a
@@ -86,7 +208,13 @@ func annotateTaskGroup(diff *structs.TaskGroupDiff, annotations *structs.PlanAnn
 				diff.Updates[UpdateTypeInplaceUpdate] = tg.InPlaceUpdate
 			}
 			if tg.DestructiveUpdate != 0 {
-				diff.Updates[UpdateTypeDestructiveUpdate] = tg.DestructiveUpdate
+				annotateRollout(diff, tg)
+			}
+			if tg.StaleIteration != 0 {
+				diff.Updates[UpdateTypeReplaceStaleIteration] = tg.StaleIteration
+				diff.Annotations = append(diff.Annotations, AnnotationStaleIteration)
+				diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+					AnnotationCodeStaleIteration, structs.AnnotationSeverityWarn, "Count", "", ""))
 			}
 		}
 	}
@@ -109,6 +237,89 @@ func annotateTaskGroup(diff *structs.TaskGroupDiff, annotations *structs.PlanAnn
 	return nil
 }
 
+// annotateRollout splits a task group's destructive-update count into its
+// phased-rollout components when the group's Update stanza calls for a
+// canary and/or rolling (MaxParallel) deployment, instead of folding
+// everything into a single opaque UpdateTypeDestructiveUpdate count.
+// tg.Canary and tg.MaxParallel are populated by the reconciler's
+// ApplyRolloutPlan (see reconcile_rollout.go), which copies them from the
+// task group's UpdateStrategy before handing DesiredUpdates to Annotate. It
+// also appends a human-readable per-batch preview, e.g. "batch 1: 2
+// canaries; batch 2-5: 3 parallel destructive; requires manual promote".
+func annotateRollout(diff *structs.TaskGroupDiff, tg *structs.DesiredUpdates) {
+	remaining := tg.DestructiveUpdate
+	if tg.Canary == 0 && tg.MaxParallel == 0 {
+		// All-at-once replacement; there's no phased rollout to describe.
+		diff.Updates[UpdateTypeDestructiveUpdate] = remaining
+		return
+	}
+
+	batch := 1
+	var preview []string
+
+	if tg.Canary > 0 {
+		canaryCount := tg.Canary
+		if canaryCount > remaining {
+			canaryCount = remaining
+		}
+		diff.Updates[UpdateTypeCanary] = canaryCount
+		diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+			AnnotationCodeCanary, structs.AnnotationSeverityWarn, "Update.Canary",
+			"", strconv.FormatUint(canaryCount, 10)))
+		preview = append(preview, fmt.Sprintf("batch %d: %d canaries", batch, canaryCount))
+		remaining -= canaryCount
+		batch++
+	}
+
+	if remaining > 0 && tg.MaxParallel > 0 {
+		parallel := uint64(tg.MaxParallel)
+		batches := (remaining + parallel - 1) / parallel
+		fullBatches := batches - 1
+		lastBatchSize := remaining - parallel*fullBatches
+
+		diff.Updates[UpdateTypeRollingBatch] = remaining
+		diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+			AnnotationCodeRollingBatch, structs.AnnotationSeverityWarn, "Update.MaxParallel",
+			"", strconv.FormatUint(parallel, 10)))
+
+		// The last batch only destroys whatever is left over, which is
+		// smaller than `parallel` unless remaining divides evenly. Report
+		// that remainder explicitly instead of claiming a full `parallel`
+		// for every batch.
+		if lastBatchSize == parallel {
+			last := batch + int(batches) - 1
+			if batches > 1 {
+				preview = append(preview, fmt.Sprintf("batch %d-%d: %d parallel destructive", batch, last, parallel))
+			} else {
+				preview = append(preview, fmt.Sprintf("batch %d: %d parallel destructive", batch, parallel))
+			}
+			batch += int(batches)
+		} else {
+			if fullBatches > 0 {
+				lastFullBatch := batch + int(fullBatches) - 1
+				if fullBatches > 1 {
+					preview = append(preview, fmt.Sprintf("batch %d-%d: %d parallel destructive", batch, lastFullBatch, parallel))
+				} else {
+					preview = append(preview, fmt.Sprintf("batch %d: %d parallel destructive", batch, parallel))
+				}
+				batch += int(fullBatches)
+			}
+			preview = append(preview, fmt.Sprintf("batch %d: %d parallel destructive", batch, lastBatchSize))
+		}
+	} else if remaining > 0 {
+		diff.Updates[UpdateTypeDestructiveUpdate] = remaining
+	}
+
+	if tg.Canary > 0 {
+		diff.Updates[UpdateTypePromote] = 1
+		diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+			AnnotationCodePromoteRequired, structs.AnnotationSeverityCritical, "Update.Canary", "", ""))
+		preview = append(preview, "requires manual promote")
+	}
+
+	diff.Annotations = append(diff.Annotations, strings.Join(preview, "; "))
+}
+
 // annotateCountChange takes a task group diff and annotates the count
 // parameter.
 func annotateCountChange(diff *structs.TaskGroupDiff) error {
@@ -142,8 +353,12 @@ func annotateCountChange(diff *structs.TaskGroupDiff) error {
 
 	if oldV < newV {
 		countDiff.Annotations = append(countDiff.Annotations, AnnotationForcesCreate)
+		countDiff.StructuredAnnotations = append(countDiff.StructuredAnnotations, structuredAnnotation(
+			AnnotationCodeCountIncrease, structs.AnnotationSeverityInfo, "Count", countDiff.Old, countDiff.New))
 	} else if newV < oldV {
 		countDiff.Annotations = append(countDiff.Annotations, AnnotationForcesDestroy)
+		countDiff.StructuredAnnotations = append(countDiff.StructuredAnnotations, structuredAnnotation(
+			AnnotationCodeCountDecrease, structs.AnnotationSeverityWarn, "Count", countDiff.Old, countDiff.New))
 	}
 
 	return nil
@@ -157,21 +372,44 @@ func annotateTask(diff *structs.TaskDiff) {
 		return
 	}
 
-	// All changes to primitive fields result in a destructive update.
-	destructive := false
-	if len(diff.Fields) != 0 {
-		destructive = true
+	// allowsInplaceTaskUpdate is the same whitelist walk the reconciler
+	// consults before deciding whether to stop/start or patch a running
+	// allocation; re-deriving destructive below from its per-field/object
+	// results (rather than a second, separate walk) keeps the plan preview
+	// and the reconciler's actual decision from diverging.
+	destructive := !allowsInplaceTaskUpdate(diff)
+
+	// Record a structured annotation per field so callers can see exactly
+	// which field path is responsible, e.g. "KillTimeout".
+	for _, fDiff := range diff.Fields {
+		if _, ok := inplaceTaskFields[fDiff.Name]; ok {
+			diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+				AnnotationCodeTaskFieldInplace, structs.AnnotationSeverityInfo, fDiff.Name, fDiff.Old, fDiff.New))
+			continue
+		}
+		diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+			AnnotationCodeTaskFieldDestructive, structs.AnnotationSeverityCritical, fDiff.Name, fDiff.Old, fDiff.New))
 	}
 
-	// Changes that can be done in-place are log configs, services and
-	// constraints.
+	// Changes to whitelisted nested objects (log configs, services,
+	// constraints, Vault policies, artifacts and signal/noop templates)
+	// can be applied in-place; anything else forces a destructive update.
+	// Each changed field of an object gets its own annotation with a dotted
+	// path such as "Config.image"; an object diff without field changes is
+	// annotated under the object name alone.
 	for _, oDiff := range diff.Objects {
-		switch oDiff.Name {
-		case "LogConfig", "Service", "Constraint":
+		code, severity := AnnotationCodeTaskObjectDestructive, structs.AnnotationSeverityCritical
+		if isInplaceObject(oDiff) {
+			code, severity = AnnotationCodeTaskObjectInplace, structs.AnnotationSeverityInfo
+		}
+		if len(oDiff.Fields) == 0 {
+			diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+				code, severity, oDiff.Name, "", ""))
 			continue
-		default:
-			destructive = true
-			break
+		}
+		for _, fDiff := range oDiff.Fields {
+			diff.StructuredAnnotations = append(diff.StructuredAnnotations, structuredAnnotation(
+				code, severity, oDiff.Name+"."+fDiff.Name, fDiff.Old, fDiff.New))
 		}
 	}
 
@@ -181,3 +419,37 @@ func annotateTask(diff *structs.TaskDiff) {
 		diff.Annotations = append(diff.Annotations, AnnotationForcesInplaceUpdate)
 	}
 }
+
+// isInplaceObject returns whether the given nested object diff can be
+// applied to a running task without a destructive update. It consults
+// inplaceTaskObjects for most object kinds. For Template and Vault diffs it
+// also looks at a ChangeMode field the diff changes: a new ChangeMode of
+// "signal" or "noop" is in-place, any other new ChangeMode (e.g. "restart")
+// is destructive. A Template or Vault diff that does not change ChangeMode
+// is treated as in-place whatever the current ChangeMode is, since the diff
+// does not carry it.
+func isInplaceObject(diff *structs.ObjectDiff) bool {
+	if _, ok := inplaceTaskObjects[diff.Name]; !ok {
+		return false
+	}
+
+	if diff.Name != "Template" && diff.Name != "Vault" {
+		return true
+	}
+
+	for _, fDiff := range diff.Fields {
+		if fDiff.Name != "ChangeMode" {
+			continue
+		}
+		switch fDiff.New {
+		case "signal", "noop":
+			return true
+		default:
+			return false
+		}
+	}
+
+	// No ChangeMode field changed, so the existing mode (whatever it is)
+	// still applies; treat the stanza itself as in-place.
+	return true
+}
@@ -0,0 +1,277 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsInplaceObject(t *testing.T) {
+	cases := []struct {
+		name    string
+		diff    *structs.ObjectDiff
+		inplace bool
+	}{
+		{
+			name:    "log config is always in-place",
+			diff:    &structs.ObjectDiff{Name: "LogConfig"},
+			inplace: true,
+		},
+		{
+			name:    "unlisted object forces destructive",
+			diff:    &structs.ObjectDiff{Name: "Resources"},
+			inplace: false,
+		},
+		{
+			name: "template with signal change mode is in-place",
+			diff: &structs.ObjectDiff{
+				Name:   "Template",
+				Fields: []*structs.FieldDiff{{Name: "ChangeMode", New: "signal"}},
+			},
+			inplace: true,
+		},
+		{
+			name: "template with restart change mode is destructive",
+			diff: &structs.ObjectDiff{
+				Name:   "Template",
+				Fields: []*structs.FieldDiff{{Name: "ChangeMode", New: "restart"}},
+			},
+			inplace: false,
+		},
+		{
+			name: "vault with noop change mode is in-place",
+			diff: &structs.ObjectDiff{
+				Name:   "Vault",
+				Fields: []*structs.FieldDiff{{Name: "ChangeMode", New: "noop"}},
+			},
+			inplace: true,
+		},
+		{
+			name: "vault with restart change mode is destructive",
+			diff: &structs.ObjectDiff{
+				Name:   "Vault",
+				Fields: []*structs.FieldDiff{{Name: "ChangeMode", New: "restart"}},
+			},
+			inplace: false,
+		},
+		{
+			name:    "vault with no ChangeMode field change is left in-place",
+			diff:    &structs.ObjectDiff{Name: "Vault"},
+			inplace: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.inplace, isInplaceObject(c.diff))
+		})
+	}
+}
+
+func TestAnnotateJobIteration(t *testing.T) {
+	cases := []struct {
+		name          string
+		annotations   *structs.PlanAnnotations
+		wantIteration uint64
+	}{
+		{
+			name:          "nil annotations is a no-op",
+			annotations:   nil,
+			wantIteration: 0,
+		},
+		{
+			name:          "zero iteration is a no-op",
+			annotations:   &structs.PlanAnnotations{Iteration: 0, LastExecution: 123},
+			wantIteration: 0,
+		},
+		{
+			name:          "non-zero iteration is copied over with LastExecution",
+			annotations:   &structs.PlanAnnotations{Iteration: 4, LastExecution: 456},
+			wantIteration: 4,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			diff := &structs.JobDiff{}
+			annotateJobIteration(diff, c.annotations)
+
+			require.Equal(t, c.wantIteration, diff.Iteration)
+			if c.wantIteration != 0 {
+				require.Equal(t, c.annotations.LastExecution, diff.LastExecution)
+			}
+		})
+	}
+}
+
+func TestAnnotateTaskGroup_StaleIteration(t *testing.T) {
+	diff := &structs.TaskGroupDiff{Type: structs.DiffTypeEdited, Name: "cache"}
+	annotations := &structs.PlanAnnotations{
+		DesiredTGUpdates: map[string]*structs.DesiredUpdates{
+			"cache": {StaleIteration: 3},
+		},
+	}
+
+	require.NoError(t, annotateTaskGroup(diff, annotations))
+
+	require.Equal(t, uint64(3), diff.Updates[UpdateTypeReplaceStaleIteration])
+	require.Contains(t, diff.Annotations, AnnotationStaleIteration)
+
+	var found bool
+	for _, a := range diff.StructuredAnnotations {
+		if a.Code == AnnotationCodeStaleIteration {
+			found = true
+			require.Equal(t, structs.AnnotationSeverityWarn, a.Severity)
+		}
+	}
+	require.True(t, found, "expected a STALE_ITERATION structured annotation")
+}
+
+func TestMarkStaleIterationAllocs(t *testing.T) {
+	allocs := []*structs.Allocation{
+		{ID: "a1", TaskGroup: "cache", Iteration: 1},
+		{ID: "a2", TaskGroup: "cache", Iteration: 2},
+		{ID: "a3", TaskGroup: "web", Iteration: 1},
+		{ID: "a4", TaskGroup: "web", Iteration: 0},
+	}
+
+	metrics := markStaleIterationAllocs(allocs, 2)
+
+	require.Equal(t, structs.AllocDesiredStatusRemove, allocs[0].DesiredStatus)
+	require.Empty(t, allocs[1].DesiredStatus)
+	require.Equal(t, structs.AllocDesiredStatusRemove, allocs[2].DesiredStatus)
+	require.Empty(t, allocs[3].DesiredStatus)
+
+	require.Equal(t, uint64(1), metrics.TaskGroups["cache"])
+	require.Equal(t, uint64(1), metrics.TaskGroups["web"])
+}
+
+func TestAnnotateCountChange_StructuredAnnotations(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new string
+		code     string
+		severity string
+	}{
+		{name: "increase", old: "1", new: "3", code: AnnotationCodeCountIncrease, severity: structs.AnnotationSeverityInfo},
+		{name: "decrease", old: "3", new: "1", code: AnnotationCodeCountDecrease, severity: structs.AnnotationSeverityWarn},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			countDiff := &structs.FieldDiff{Name: "Count", Old: c.old, New: c.new}
+			diff := &structs.TaskGroupDiff{
+				Type:   structs.DiffTypeEdited,
+				Fields: []*structs.FieldDiff{countDiff},
+			}
+
+			require.NoError(t, annotateCountChange(diff))
+
+			require.Len(t, countDiff.StructuredAnnotations, 1)
+			require.Equal(t, c.code, countDiff.StructuredAnnotations[0].Code)
+			require.Equal(t, c.severity, countDiff.StructuredAnnotations[0].Severity)
+			require.Equal(t, map[string]string{"old": c.old, "new": c.new}, countDiff.StructuredAnnotations[0].Detail)
+		})
+	}
+}
+
+func TestAnnotateTask_StructuredAnnotations(t *testing.T) {
+	diff := &structs.TaskDiff{
+		Type: structs.DiffTypeEdited,
+		Fields: []*structs.FieldDiff{
+			{Name: "Env", Old: "a", New: "b"},
+			{Name: "Config", Old: "a", New: "b"},
+		},
+		Objects: []*structs.ObjectDiff{
+			{Name: "LogConfig"},
+			{Name: "Resources"},
+		},
+	}
+
+	annotateTask(diff)
+
+	require.Contains(t, diff.Annotations, AnnotationForcesDestructiveUpdate)
+
+	var codes []string
+	for _, a := range diff.StructuredAnnotations {
+		codes = append(codes, a.Code)
+	}
+	require.ElementsMatch(t, []string{
+		AnnotationCodeTaskFieldInplace,
+		AnnotationCodeTaskFieldDestructive,
+		AnnotationCodeTaskObjectInplace,
+		AnnotationCodeTaskObjectDestructive,
+	}, codes)
+}
+
+func TestApplyRolloutPlan(t *testing.T) {
+	t.Run("nil update is a no-op", func(t *testing.T) {
+		du := &structs.DesiredUpdates{Canary: 1, MaxParallel: 2}
+		ApplyRolloutPlan(nil, du)
+		require.Equal(t, uint64(1), du.Canary)
+		require.Equal(t, 2, du.MaxParallel)
+	})
+
+	t.Run("copies Canary and MaxParallel from the update stanza", func(t *testing.T) {
+		du := &structs.DesiredUpdates{}
+		ApplyRolloutPlan(&structs.UpdateStrategy{Canary: 3, MaxParallel: 5}, du)
+		require.Equal(t, uint64(3), du.Canary)
+		require.Equal(t, 5, du.MaxParallel)
+	})
+}
+
+func TestAnnotateRollout(t *testing.T) {
+	cases := []struct {
+		name    string
+		tg      *structs.DesiredUpdates
+		updates map[string]uint64
+		preview string
+	}{
+		{
+			name:    "all at once has no rollout to describe",
+			tg:      &structs.DesiredUpdates{DestructiveUpdate: 5},
+			updates: map[string]uint64{UpdateTypeDestructiveUpdate: 5},
+		},
+		{
+			name: "rolling batch smaller than MaxParallel reports the remainder, not MaxParallel",
+			tg:   &structs.DesiredUpdates{DestructiveUpdate: 2, MaxParallel: 3},
+			updates: map[string]uint64{
+				UpdateTypeRollingBatch: 2,
+			},
+			preview: "batch 1: 2 parallel destructive",
+		},
+		{
+			name: "rolling batches with a partial final batch",
+			tg:   &structs.DesiredUpdates{DestructiveUpdate: 7, MaxParallel: 3},
+			updates: map[string]uint64{
+				UpdateTypeRollingBatch: 7,
+			},
+			preview: "batch 1-2: 3 parallel destructive; batch 3: 1 parallel destructive",
+		},
+		{
+			name: "canary followed by an exact rolling batch",
+			tg:   &structs.DesiredUpdates{DestructiveUpdate: 8, Canary: 2, MaxParallel: 3},
+			updates: map[string]uint64{
+				UpdateTypeCanary:       2,
+				UpdateTypeRollingBatch: 6,
+				UpdateTypePromote:      1,
+			},
+			preview: "batch 1: 2 canaries; batch 2-3: 3 parallel destructive; requires manual promote",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			diff := &structs.TaskGroupDiff{Updates: map[string]uint64{}}
+			annotateRollout(diff, c.tg)
+
+			for updateType, count := range c.updates {
+				require.Equal(t, count, diff.Updates[updateType], "update type %q", updateType)
+			}
+			if c.preview != "" {
+				require.Contains(t, diff.Annotations, c.preview)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package scheduler
+
+import "github.com/hashicorp/nomad/nomad/structs"
+
+// allowsInplaceTaskUpdate reports whether every changed field and object in
+// a task diff is on the inplaceTaskFields/inplaceTaskObjects whitelist. It
+// is the single decision point annotateTask and the reconciler's allocation
+// update path both call, so the plan preview can never promise an in-place
+// update that the reconciler then turns into a destructive one (or vice
+// versa).
+func allowsInplaceTaskUpdate(diff *structs.TaskDiff) bool {
+	for _, fDiff := range diff.Fields {
+		if _, ok := inplaceTaskFields[fDiff.Name]; !ok {
+			return false
+		}
+	}
+
+	for _, oDiff := range diff.Objects {
+		if !isInplaceObject(oDiff) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,17 @@
+package scheduler
+
+import "github.com/hashicorp/nomad/nomad/structs"
+
+// ApplyRolloutPlan copies a task group's UpdateStrategy onto the
+// DesiredUpdates the reconciler is about to hand to Annotate via
+// PlanAnnotations, so annotateRollout's canary/rolling-batch preview
+// describes the same deployment plan the reconciler is actually executing
+// rather than an opaque destructive-update count.
+func ApplyRolloutPlan(update *structs.UpdateStrategy, du *structs.DesiredUpdates) {
+	if update == nil {
+		return
+	}
+
+	du.Canary = update.Canary
+	du.MaxParallel = update.MaxParallel
+}
@@ -0,0 +1,24 @@
+package scheduler
+
+import "github.com/hashicorp/nomad/nomad/structs"
+
+// markStaleIterationAllocs finds allocations belonging to an iteration older
+// than the job's current one and marks them structs.AllocDesiredStatusRemove
+// so the client GCs them the next time it reports in, instead of leaving
+// them to linger as if they were a normal running allocation. It returns an
+// AllocMetrics tally of how many allocations were marked per task group, the
+// same count annotateTaskGroup renders as DesiredUpdates.StaleIteration.
+func markStaleIterationAllocs(allocs []*structs.Allocation, currentIteration uint64) *structs.AllocMetrics {
+	metrics := &structs.AllocMetrics{TaskGroups: make(map[string]uint64)}
+
+	for _, alloc := range allocs {
+		if alloc.Iteration == 0 || alloc.Iteration >= currentIteration {
+			continue
+		}
+
+		alloc.DesiredStatus = structs.AllocDesiredStatusRemove
+		metrics.TaskGroups[alloc.TaskGroup]++
+	}
+
+	return metrics
+}